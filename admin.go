@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// AdminConfig configures the optional presigned-URL issuance endpoint. It is
+// served on its own listener so it is never exposed on a public vhost.
+type AdminConfig struct {
+	Listen               string `mapstructure:"listen"`
+	BearerToken          string `mapstructure:"bearer_token"`
+	DefaultExpirySeconds int64  `mapstructure:"default_expiry_seconds"`
+	MaxExpirySeconds     int64  `mapstructure:"max_expiry_seconds"`
+}
+
+// presignResponse is the JSON body returned by the presign endpoint.
+type presignResponse struct {
+	URL       string `json:"url"`
+	Method    string `json:"method"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// adminServer handles the admin/API endpoint that issues presigned S3 URLs.
+type adminServer struct {
+	proxy *S3Proxy
+}
+
+// newAdminServer creates the handler for proxy's admin listener.
+func newAdminServer(proxy *S3Proxy) *adminServer {
+	return &adminServer{proxy: proxy}
+}
+
+// ServeHTTP dispatches admin endpoint requests.
+func (a *adminServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/presign":
+		a.handlePresign(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authorized validates the bearer token configured for the admin endpoint.
+func (a *adminServer) authorized(r *http.Request) bool {
+	cfg := a.proxy.config.Admin
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if len(header) <= len(prefix) || header[:len(prefix)] != prefix {
+		return false
+	}
+	token := header[len(prefix):]
+	return subtle.ConstantTimeCompare([]byte(token), []byte(cfg.BearerToken)) == 1
+}
+
+// handlePresign issues a presigned GET or PUT URL for an object in a configured domain's bucket.
+func (a *adminServer) handlePresign(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	domain := q.Get("domain")
+	key := q.Get("key")
+	method := q.Get("method")
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	storageConfig, exists := a.proxy.config.Domains[domain]
+	if !exists {
+		http.Error(w, "unknown domain", http.StatusNotFound)
+		return
+	}
+	client, ok := a.proxy.s3Clients[domain]
+	if !ok {
+		http.Error(w, "no S3 client for domain", http.StatusInternalServerError)
+		return
+	}
+	key = withPathPrefix(storageConfig, key)
+
+	expiry, err := a.resolveExpiry(q.Get("expires_in"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	presignClient := s3.NewPresignClient(client)
+
+	var url, presignedMethod string
+	switch method {
+	case http.MethodGet:
+		out, err := presignClient.PresignGetObject(context.TODO(), &s3.GetObjectInput{
+			Bucket: aws.String(storageConfig.Bucket),
+			Key:    aws.String(key),
+		}, s3.WithPresignExpires(expiry))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		url, presignedMethod = out.URL, out.Method
+
+	case http.MethodPut:
+		out, err := presignClient.PresignPutObject(context.TODO(), &s3.PutObjectInput{
+			Bucket: aws.String(storageConfig.Bucket),
+			Key:    aws.String(key),
+		}, s3.WithPresignExpires(expiry))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		url, presignedMethod = out.URL, out.Method
+
+	default:
+		http.Error(w, "method must be GET or PUT", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(presignResponse{
+		URL:       url,
+		Method:    presignedMethod,
+		ExpiresAt: time.Now().Add(expiry).Format(time.RFC3339),
+	})
+}
+
+// resolveExpiry parses the expires_in query parameter (seconds), falling back to
+// the admin endpoint's default and clamping to its configured maximum.
+func (a *adminServer) resolveExpiry(expiresIn string) (time.Duration, error) {
+	cfg := a.proxy.config.Admin
+
+	seconds := cfg.DefaultExpirySeconds
+	if seconds == 0 {
+		seconds = 900
+	}
+	if expiresIn != "" {
+		parsed, err := strconv.ParseInt(expiresIn, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		seconds = parsed
+	}
+
+	if max := cfg.MaxExpirySeconds; max > 0 && seconds > max {
+		seconds = max
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
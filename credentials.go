@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// buildCredentialsProvider returns the aws.CredentialsProvider selected by cfg.CredentialsMode.
+func buildCredentialsProvider(cfg StorageConfig) (aws.CredentialsProvider, error) {
+	switch cfg.CredentialsMode {
+	case "", "static":
+		return credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, ""), nil
+
+	case "default":
+		awsCfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(cfg.Region))
+		if err != nil {
+			return nil, err
+		}
+		return awsCfg.Credentials, nil
+
+	case "profile":
+		if cfg.ProfileName == "" {
+			return nil, fmt.Errorf("credentials_mode \"profile\" requires profile_name")
+		}
+		awsCfg, err := config.LoadDefaultConfig(context.TODO(),
+			config.WithRegion(cfg.Region),
+			config.WithSharedConfigProfile(cfg.ProfileName),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return awsCfg.Credentials, nil
+
+	case "assume_role":
+		if cfg.RoleARN == "" {
+			return nil, fmt.Errorf("credentials_mode \"assume_role\" requires role_arn")
+		}
+		awsCfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(cfg.Region))
+		if err != nil {
+			return nil, err
+		}
+		client := sts.NewFromConfig(awsCfg)
+		provider := stscreds.NewAssumeRoleProvider(client, cfg.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			if cfg.ExternalID != "" {
+				o.ExternalID = aws.String(cfg.ExternalID)
+			}
+			if cfg.SessionName != "" {
+				o.RoleSessionName = cfg.SessionName
+			}
+			if cfg.DurationSeconds > 0 {
+				o.Duration = time.Duration(cfg.DurationSeconds) * time.Second
+			}
+		})
+		return aws.NewCredentialsCache(provider), nil
+
+	case "web_identity":
+		if cfg.RoleARN == "" || cfg.TokenFile == "" {
+			return nil, fmt.Errorf("credentials_mode \"web_identity\" requires role_arn and token_file")
+		}
+		awsCfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(cfg.Region))
+		if err != nil {
+			return nil, err
+		}
+		client := sts.NewFromConfig(awsCfg)
+		provider := stscreds.NewWebIdentityRoleProvider(client, cfg.RoleARN, stscreds.IdentityTokenFile(cfg.TokenFile), func(o *stscreds.WebIdentityRoleOptions) {
+			if cfg.SessionName != "" {
+				o.RoleSessionName = cfg.SessionName
+			}
+		})
+		return aws.NewCredentialsCache(provider), nil
+
+	default:
+		return nil, fmt.Errorf("unknown credentials_mode: %s", cfg.CredentialsMode)
+	}
+}
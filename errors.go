@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// s3ErrorStatusCode maps an error returned by the S3 SDK to the HTTP status code
+// that should be sent to the client. Conditional-request outcomes such as a 304
+// Not Modified from a failed If-None-Match are passed through verbatim instead
+// of being collapsed to a generic 404.
+func s3ErrorStatusCode(err error) int {
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) && respErr.Response != nil {
+		switch respErr.Response.StatusCode {
+		case http.StatusNotModified, http.StatusPreconditionFailed:
+			return respErr.Response.StatusCode
+		}
+	}
+	return http.StatusNotFound
+}
+
+// withRequestHeader returns a per-call S3 client option that sets a raw HTTP
+// header on the outgoing request. It's used for headers like Accept-Encoding
+// that have no dedicated field on the S3 API input types.
+func withRequestHeader(key, value string) func(*s3.Options) {
+	return func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Build.Add(middleware.BuildMiddlewareFunc("SetHeader:"+key, func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+				if req, ok := in.Request.(*smithyhttp.Request); ok {
+					req.Header.Set(key, value)
+				}
+				return next.HandleBuild(ctx, in)
+			}), middleware.After)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// maxIndexKeys caps the number of keys returned per directory listing page
+const maxIndexKeys = 1000
+
+// IndexObject describes a single object rendered as part of a directory listing
+type IndexObject struct {
+	Key          string
+	Size         int64
+	LastModified string
+	ETag         string
+}
+
+// IndexData is the value passed to a domain's IndexTemplate
+type IndexData struct {
+	Path                  string
+	CommonPrefixes        []string
+	Contents              []IndexObject
+	KeyCount              int32
+	MaxKeys               int32
+	NextContinuationToken string
+}
+
+// serveIndex renders an HTML directory listing for objectPath, or serves the
+// domain's IndexKey object directly if one exists under that directory.
+func (p *S3Proxy) serveIndex(w http.ResponseWriter, r *http.Request, domain string, client *s3.Client, cfg StorageConfig, objectPath string) {
+	if cfg.IndexKey != "" {
+		result, err := client.GetObject(context.TODO(), &s3.GetObjectInput{
+			Bucket: aws.String(cfg.Bucket),
+			Key:    aws.String(objectPath + cfg.IndexKey),
+		})
+		if err == nil {
+			defer result.Body.Close()
+			p.setResponseHeaders(w, result, cfg)
+			if r.Method != http.MethodHead {
+				io.Copy(w, result.Body)
+			}
+			return
+		}
+	}
+
+	tmpl, ok := p.indexTemplates[domain]
+	if !ok {
+		p.Error(w, http.StatusNotFound)
+		return
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(cfg.Bucket),
+		Prefix:    aws.String(objectPath),
+		Delimiter: aws.String("/"),
+		MaxKeys:   aws.Int32(maxIndexKeys),
+	}
+	if token := r.URL.Query().Get("continue"); token != "" {
+		input.ContinuationToken = aws.String(token)
+	}
+
+	result, err := client.ListObjectsV2(context.TODO(), input)
+	if err != nil {
+		p.Error(w, http.StatusInternalServerError)
+		return
+	}
+
+	data := IndexData{
+		Path:     "/" + objectPath,
+		KeyCount: aws.ToInt32(result.KeyCount),
+		MaxKeys:  aws.ToInt32(result.MaxKeys),
+	}
+	for _, prefix := range result.CommonPrefixes {
+		data.CommonPrefixes = append(data.CommonPrefixes, aws.ToString(prefix.Prefix))
+	}
+	for _, obj := range result.Contents {
+		entry := IndexObject{
+			Key:  aws.ToString(obj.Key),
+			Size: aws.ToInt64(obj.Size),
+			ETag: aws.ToString(obj.ETag),
+		}
+		if obj.LastModified != nil {
+			entry.LastModified = obj.LastModified.Format(http.TimeFormat)
+		}
+		data.Contents = append(data.Contents, entry)
+	}
+	if result.NextContinuationToken != nil {
+		data.NextContinuationToken = aws.ToString(result.NextContinuationToken)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, data); err != nil {
+		p.Error(w, http.StatusInternalServerError)
+	}
+}
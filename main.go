@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"html/template"
 	"io"
 	"log"
 	"net/http"
@@ -12,32 +13,56 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/spf13/viper"
 )
 
 // StorageConfig represents the configuration for a storage provider
 type StorageConfig struct {
-	Bucket       string `mapstructure:"bucket"`
-	Region       string `mapstructure:"region"`
-	Endpoint     string `mapstructure:"endpoint"`
-	AccessKey    string `mapstructure:"access_key"`
-	SecretKey    string `mapstructure:"secret_key"`
-	PathPrefix   string `mapstructure:"path_prefix"`
-	UsePathStyle bool   `mapstructure:"use_path_style"` // Required for MinIO
+	Bucket        string `mapstructure:"bucket"`
+	Region        string `mapstructure:"region"`
+	Endpoint      string `mapstructure:"endpoint"`
+	AccessKey     string `mapstructure:"access_key"`
+	SecretKey     string `mapstructure:"secret_key"`
+	PathPrefix    string `mapstructure:"path_prefix"`
+	UsePathStyle  bool   `mapstructure:"use_path_style"` // Required for MinIO
+	AutoIndex     bool   `mapstructure:"auto_index"`     // Render an HTML directory listing for "/" paths
+	IndexKey      string `mapstructure:"index_key"`      // e.g. "index.html"; served instead of a listing when present
+	IndexTemplate string `mapstructure:"index_template"` // Path to a html/template used to render directory listings
+
+	// CredentialsMode selects how the S3 client for this domain obtains credentials:
+	// "static" (default, uses AccessKey/SecretKey), "default" (SDK default chain,
+	// including env/EC2 instance profile/ECS task role/IMDSv2), "profile" (shared
+	// config/credentials profile), "assume_role" (STS AssumeRole) or
+	// "web_identity" (STS AssumeRoleWithWebIdentity, e.g. EKS IRSA).
+	CredentialsMode string `mapstructure:"credentials_mode"`
+	ProfileName     string `mapstructure:"profile_name"`     // credentials_mode: profile
+	RoleARN         string `mapstructure:"role_arn"`         // credentials_mode: assume_role, web_identity
+	ExternalID      string `mapstructure:"external_id"`      // credentials_mode: assume_role
+	SessionName     string `mapstructure:"session_name"`     // credentials_mode: assume_role, web_identity
+	DurationSeconds int32  `mapstructure:"duration_seconds"` // credentials_mode: assume_role
+	TokenFile       string `mapstructure:"token_file"`       // credentials_mode: web_identity
+
+	CORSOrigin string `mapstructure:"cors_origin"` // Access-Control-Allow-Origin value; defaults to "*"
+
+	Writable       bool   `mapstructure:"writable"`        // Allow PUT/POST/DELETE (single-object and multipart uploads)
+	WriteAuthToken string `mapstructure:"write_auth_token"` // Bearer token required for writes when S3CompatMode is off
 }
 
 // ProxyConfig represents the main proxy configuration
 type ProxyConfig struct {
-	Domains map[string]StorageConfig `mapstructure:"domains"`
-	Port    string                   `mapstructure:"port"`
+	Domains      map[string]StorageConfig `mapstructure:"domains"`
+	Port         string                   `mapstructure:"port"`
+	S3CompatMode bool                     `mapstructure:"s3_compat_mode"` // Authenticate requests with AWS SigV4 and speak the S3 REST API
+	Principals   map[string]Principal     `mapstructure:"principals"`     // access_key_id -> secret + ACL, required when S3CompatMode is set
+	Admin        *AdminConfig             `mapstructure:"admin"`          // Optional presigned-URL issuance endpoint, on its own listener
 }
 
 // S3Proxy represents the S3 proxy server
 type S3Proxy struct {
-	config    *ProxyConfig
-	s3Clients map[string]*s3.Client
+	config         *ProxyConfig
+	s3Clients      map[string]*s3.Client
+	indexTemplates map[string]*template.Template
 }
 
 // NewS3Proxy creates a new S3 proxy instance
@@ -48,8 +73,9 @@ func NewS3Proxy(configFile string) (*S3Proxy, error) {
 	}
 
 	proxy := &S3Proxy{
-		config:    config,
-		s3Clients: make(map[string]*s3.Client),
+		config:         config,
+		s3Clients:      make(map[string]*s3.Client),
+		indexTemplates: make(map[string]*template.Template),
 	}
 
 	// Create S3 client for each domain
@@ -59,6 +85,14 @@ func NewS3Proxy(configFile string) (*S3Proxy, error) {
 			return nil, fmt.Errorf("failed to create S3 client for %s: %v", domain, err)
 		}
 		proxy.s3Clients[domain] = client
+
+		if storageConfig.AutoIndex && storageConfig.IndexTemplate != "" {
+			tmpl, err := template.ParseFiles(storageConfig.IndexTemplate)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse index template for %s: %v", domain, err)
+			}
+			proxy.indexTemplates[domain] = tmpl
+		}
 	}
 
 	return proxy, nil
@@ -83,11 +117,14 @@ func loadConfig(configFile string) (*ProxyConfig, error) {
 
 // createS3Client creates an S3 client with the given configuration
 func (p *S3Proxy) createS3Client(cfg StorageConfig) (*s3.Client, error) {
+	credsProvider, err := buildCredentialsProvider(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build credentials provider: %v", err)
+	}
+
 	awsCfg, err := config.LoadDefaultConfig(context.TODO(),
 		config.WithRegion(cfg.Region),
-		config.WithCredentialsProvider(
-			credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, ""),
-		),
+		config.WithCredentialsProvider(credsProvider),
 	)
 	if err != nil {
 		return nil, err
@@ -110,8 +147,9 @@ func (p *S3Proxy) Error(w http.ResponseWriter, code int) {
 
 // ServeHTTP handles HTTP requests
 func (p *S3Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Only support GET and HEAD requests
-	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPost, http.MethodDelete:
+	default:
 		p.Error(w, http.StatusMethodNotAllowed)
 		return
 	}
@@ -139,29 +177,91 @@ func (p *S3Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		objectPath = strings.TrimSuffix(storageConfig.PathPrefix, "/") + "/" + objectPath
 	}
 
+	var principal Principal
+	if p.config.S3CompatMode {
+		var err error
+		principal, err = p.verifySigV4(r)
+		if err != nil {
+			log.Printf("SigV4 verification failed: %v", err)
+			p.Error(w, http.StatusForbidden)
+			return
+		}
+
+		// Bucket-level operations (location, listing) have no single object key to
+		// check against objectPath (which is "" at the bucket root); each handler
+		// authorizes itself against the bucket/prefix it actually operates on.
+		switch {
+		case objectPath == "" && r.URL.Query().Has("location"):
+			p.handleGetBucketLocation(w, storageConfig, principal)
+			return
+		case objectPath == "" && r.URL.Query().Get("list-type") == "2":
+			p.handleListObjectsV2(w, r, client, storageConfig, principal)
+			return
+		case objectPath == "":
+			p.handleListObjectsV1(w, r, client, storageConfig, principal)
+			return
+		}
+
+		if !principal.authorized(storageConfig.Bucket, objectPath) {
+			p.Error(w, http.StatusForbidden)
+			return
+		}
+	}
+
+	isWrite := r.Method == http.MethodPut || r.Method == http.MethodPost || r.Method == http.MethodDelete
+	if isWrite {
+		if !storageConfig.Writable {
+			p.Error(w, http.StatusForbidden)
+			return
+		}
+		if !p.authorizeWrite(r, storageConfig, principal) {
+			p.Error(w, http.StatusForbidden)
+			return
+		}
+		p.serveWrite(w, r, client, storageConfig, objectPath)
+		return
+	}
+
+	// Directory requests are served as an auto-generated index instead of a 404
+	if storageConfig.AutoIndex && strings.HasSuffix(r.URL.Path, "/") {
+		p.serveIndex(w, r, domain, client, storageConfig, objectPath)
+		return
+	}
+
 	log.Printf("Request: %s %s -> %s/%s", r.Method, r.URL.Path, storageConfig.Bucket, objectPath)
 
-	// Create GetObject request
+	// Create GetObject request, forwarding Range plus conditional/cache/SSE-C headers
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(storageConfig.Bucket),
 		Key:    aws.String(objectPath),
 	}
+	applyConditionalHeaders(input, r)
 
-	// Support Range requests for resumable downloads
-	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
-		input.Range = aws.String(rangeHeader)
+	p.serveObject(w, r, client, input, storageConfig)
+}
+
+// serveObject executes a GetObject request and streams the result to the client
+func (p *S3Proxy) serveObject(w http.ResponseWriter, r *http.Request, client *s3.Client, input *s3.GetObjectInput, cfg StorageConfig) {
+	var opts []func(*s3.Options)
+	if acceptEncoding := r.Header.Get("Accept-Encoding"); acceptEncoding != "" {
+		opts = append(opts, withRequestHeader("Accept-Encoding", acceptEncoding))
 	}
 
-	// Execute S3 request
-	result, err := client.GetObject(context.TODO(), input)
+	result, err := client.GetObject(context.TODO(), input, opts...)
 	if err != nil {
-		p.Error(w, http.StatusNotFound)
+		code := s3ErrorStatusCode(err)
+		if code == http.StatusNotModified {
+			// RFC 7232: a 304 response must not carry a body
+			w.WriteHeader(code)
+			return
+		}
+		p.Error(w, code)
 		return
 	}
 	defer result.Body.Close()
 
 	// Set response headers
-	p.setResponseHeaders(w, result)
+	p.setResponseHeaders(w, result, cfg)
 
 	// HEAD request only returns headers
 	if r.Method == http.MethodHead {
@@ -175,9 +275,47 @@ func (p *S3Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// applyConditionalHeaders copies the allowlisted conditional-request, cache, and
+// SSE-C request headers onto an S3 GetObjectInput.
+func applyConditionalHeaders(input *s3.GetObjectInput, r *http.Request) {
+	if v := r.Header.Get("Range"); v != "" {
+		input.Range = aws.String(v)
+	}
+	if v := r.Header.Get("If-Match"); v != "" {
+		input.IfMatch = aws.String(v)
+	}
+	if v := r.Header.Get("If-None-Match"); v != "" {
+		input.IfNoneMatch = aws.String(v)
+	}
+	if v := r.Header.Get("If-Modified-Since"); v != "" {
+		if t, err := http.ParseTime(v); err == nil {
+			input.IfModifiedSince = aws.Time(t)
+		}
+	}
+	if v := r.Header.Get("If-Unmodified-Since"); v != "" {
+		if t, err := http.ParseTime(v); err == nil {
+			input.IfUnmodifiedSince = aws.Time(t)
+		}
+	}
+	if v := r.Header.Get("x-amz-server-side-encryption-customer-algorithm"); v != "" {
+		input.SSECustomerAlgorithm = aws.String(v)
+	}
+	if v := r.Header.Get("x-amz-server-side-encryption-customer-key"); v != "" {
+		input.SSECustomerKey = aws.String(v)
+	}
+	if v := r.Header.Get("x-amz-server-side-encryption-customer-key-MD5"); v != "" {
+		input.SSECustomerKeyMD5 = aws.String(v)
+	}
+}
+
 // setResponseHeaders sets the appropriate response headers
-func (p *S3Proxy) setResponseHeaders(w http.ResponseWriter, result *s3.GetObjectOutput) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+func (p *S3Proxy) setResponseHeaders(w http.ResponseWriter, result *s3.GetObjectOutput, cfg StorageConfig) {
+	origin := cfg.CORSOrigin
+	if origin == "" {
+		origin = "*"
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Accept-Ranges", "bytes")
 
 	if result.ContentType != nil {
 		w.Header().Set("Content-Type", *result.ContentType)
@@ -194,6 +332,15 @@ func (p *S3Proxy) setResponseHeaders(w http.ResponseWriter, result *s3.GetObject
 	if result.CacheControl != nil {
 		w.Header().Set("Cache-Control", *result.CacheControl)
 	}
+	if result.ContentRange != nil {
+		w.Header().Set("Content-Range", *result.ContentRange)
+	}
+	if result.ContentEncoding != nil {
+		w.Header().Set("Content-Encoding", *result.ContentEncoding)
+	}
+	if result.ContentDisposition != nil {
+		w.Header().Set("Content-Disposition", *result.ContentDisposition)
+	}
 }
 
 // generateSampleConfig generates a sample configuration file
@@ -209,6 +356,22 @@ func generateSampleConfig(configFile string) error {
 	v.Set("domains::example.com::secret_key", "<your-s3-secret-key>")
 	v.Set("domains::example.com::path_prefix", "<your-s3-path-prefix>")
 	v.Set("domains::example.com::use_path_style", false)
+	v.Set("domains::example.com::credentials_mode", "static")
+	v.Set("domains::example.com::cors_origin", "*")
+	v.Set("domains::example.com::writable", false)
+	v.Set("domains::example.com::write_auth_token", "<your-write-auth-token>")
+	v.Set("domains::example.com::auto_index", false)
+	v.Set("domains::example.com::index_key", "index.html")
+	v.Set("domains::example.com::index_template", "<path-to-index.html.tmpl>")
+	v.Set("s3_compat_mode", false)
+	v.Set("principals::<your-access-key-id>::secret_key", "<your-secret-key>")
+	v.Set("principals::<your-access-key-id>::allowed_bucket", "<your-s3-bucket>")
+	v.Set("principals::<your-access-key-id>::allowed_prefix", "")
+	v.Set("principals::<your-access-key-id>::allow_write", false)
+	v.Set("admin::listen", ":9090")
+	v.Set("admin::bearer_token", "<your-admin-bearer-token>")
+	v.Set("admin::default_expiry_seconds", 900)
+	v.Set("admin::max_expiry_seconds", 86400)
 
 	if err := v.WriteConfigAs(configFile); err != nil {
 		return fmt.Errorf("failed to write config file: %v", err)
@@ -256,5 +419,18 @@ func main() {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	if proxy.config.Admin != nil {
+		admin := &http.Server{
+			Addr:         proxy.config.Admin.Listen,
+			Handler:      newAdminServer(proxy),
+			ReadTimeout:  30 * time.Second,
+			WriteTimeout: 30 * time.Second,
+		}
+		log.Printf("Admin presign server starting on %s", proxy.config.Admin.Listen)
+		go func() {
+			log.Fatal(admin.ListenAndServe())
+		}()
+	}
+
 	log.Fatal(server.ListenAndServe())
 }
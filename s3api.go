@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// s3Namespace is the XML namespace S3 clients (aws-cli, s3cmd, rclone) expect on list/location responses.
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// locationConstraint is the body of a GetBucketLocation response.
+type locationConstraint struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LocationConstraint"`
+	Value   string   `xml:",chardata"`
+}
+
+// listBucketContent mirrors the <Contents> element of a ListObjects(V1/V2) response.
+type listBucketContent struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+// listBucketCommonPrefix mirrors the <CommonPrefixes> element.
+type listBucketCommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// listObjectsV2Result is the XML body of a ListObjectsV2 response.
+type listObjectsV2Result struct {
+	XMLName               xml.Name                 `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string                   `xml:"Name"`
+	Prefix                string                   `xml:"Prefix"`
+	Delimiter             string                   `xml:"Delimiter,omitempty"`
+	KeyCount              int32                    `xml:"KeyCount"`
+	MaxKeys               int32                    `xml:"MaxKeys"`
+	IsTruncated           bool                     `xml:"IsTruncated"`
+	ContinuationToken     string                   `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string                   `xml:"NextContinuationToken,omitempty"`
+	Contents              []listBucketContent      `xml:"Contents"`
+	CommonPrefixes        []listBucketCommonPrefix `xml:"CommonPrefixes"`
+}
+
+// listObjectsV1Result is the XML body of the legacy ListObjects (v1) response.
+type listObjectsV1Result struct {
+	XMLName        xml.Name                 `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name           string                   `xml:"Name"`
+	Prefix         string                   `xml:"Prefix"`
+	Marker         string                   `xml:"Marker"`
+	Delimiter      string                   `xml:"Delimiter,omitempty"`
+	MaxKeys        int32                    `xml:"MaxKeys"`
+	IsTruncated    bool                     `xml:"IsTruncated"`
+	NextMarker     string                   `xml:"NextMarker,omitempty"`
+	Contents       []listBucketContent      `xml:"Contents"`
+	CommonPrefixes []listBucketCommonPrefix `xml:"CommonPrefixes"`
+}
+
+// writeXML marshals v as an XML document with the standard header and writes it to w.
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// withPathPrefix combines a domain's PathPrefix with a client-supplied key or
+// prefix the same way ServeHTTP builds objectPath, so every code path that
+// turns client input into an S3 key is confined to the same key space a
+// GetObject on this domain would be.
+func withPathPrefix(cfg StorageConfig, clientKey string) string {
+	if cfg.PathPrefix == "" {
+		return clientKey
+	}
+	return strings.TrimSuffix(cfg.PathPrefix, "/") + "/" + clientKey
+}
+
+// handleGetBucketLocation answers ?location with the domain's configured region.
+func (p *S3Proxy) handleGetBucketLocation(w http.ResponseWriter, cfg StorageConfig, principal Principal) {
+	if !principal.authorizedBucket(cfg.Bucket) {
+		p.Error(w, http.StatusForbidden)
+		return
+	}
+	writeXML(w, locationConstraint{Value: cfg.Region})
+}
+
+// handleListObjectsV2 answers ?list-type=2 with a ListObjectsV2-shaped XML body.
+func (p *S3Proxy) handleListObjectsV2(w http.ResponseWriter, r *http.Request, client *s3.Client, cfg StorageConfig, principal Principal) {
+	q := r.URL.Query()
+	effectivePrefix := withPathPrefix(cfg, q.Get("prefix"))
+	if !principal.authorized(cfg.Bucket, effectivePrefix) {
+		p.Error(w, http.StatusForbidden)
+		return
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(cfg.Bucket),
+		Prefix:    aws.String(effectivePrefix),
+		Delimiter: aws.String(q.Get("delimiter")),
+		MaxKeys:   aws.Int32(maxIndexKeys),
+	}
+	if token := q.Get("continuation-token"); token != "" {
+		input.ContinuationToken = aws.String(token)
+	}
+
+	result, err := client.ListObjectsV2(context.TODO(), input)
+	if err != nil {
+		p.Error(w, http.StatusInternalServerError)
+		return
+	}
+
+	out := listObjectsV2Result{
+		Name:                  cfg.Bucket,
+		Prefix:                q.Get("prefix"),
+		Delimiter:             q.Get("delimiter"),
+		KeyCount:              aws.ToInt32(result.KeyCount),
+		MaxKeys:               aws.ToInt32(result.MaxKeys),
+		IsTruncated:           aws.ToBool(result.IsTruncated),
+		ContinuationToken:     q.Get("continuation-token"),
+		NextContinuationToken: aws.ToString(result.NextContinuationToken),
+	}
+	for _, obj := range result.Contents {
+		out.Contents = append(out.Contents, toListBucketContent(obj))
+	}
+	for _, prefix := range result.CommonPrefixes {
+		out.CommonPrefixes = append(out.CommonPrefixes, listBucketCommonPrefix{Prefix: aws.ToString(prefix.Prefix)})
+	}
+
+	writeXML(w, out)
+}
+
+// handleListObjectsV1 answers the legacy ListObjects request (no list-type query param).
+func (p *S3Proxy) handleListObjectsV1(w http.ResponseWriter, r *http.Request, client *s3.Client, cfg StorageConfig, principal Principal) {
+	q := r.URL.Query()
+	effectivePrefix := withPathPrefix(cfg, q.Get("prefix"))
+	if !principal.authorized(cfg.Bucket, effectivePrefix) {
+		p.Error(w, http.StatusForbidden)
+		return
+	}
+
+	input := &s3.ListObjectsInput{
+		Bucket:    aws.String(cfg.Bucket),
+		Prefix:    aws.String(effectivePrefix),
+		Delimiter: aws.String(q.Get("delimiter")),
+		Marker:    aws.String(q.Get("marker")),
+		MaxKeys:   aws.Int32(maxIndexKeys),
+	}
+
+	result, err := client.ListObjects(context.TODO(), input)
+	if err != nil {
+		p.Error(w, http.StatusInternalServerError)
+		return
+	}
+
+	out := listObjectsV1Result{
+		Name:        cfg.Bucket,
+		Prefix:      q.Get("prefix"),
+		Marker:      q.Get("marker"),
+		Delimiter:   q.Get("delimiter"),
+		MaxKeys:     aws.ToInt32(result.MaxKeys),
+		IsTruncated: aws.ToBool(result.IsTruncated),
+		NextMarker:  aws.ToString(result.NextMarker),
+	}
+	for _, obj := range result.Contents {
+		out.Contents = append(out.Contents, toListBucketContent(obj))
+	}
+	for _, prefix := range result.CommonPrefixes {
+		out.CommonPrefixes = append(out.CommonPrefixes, listBucketCommonPrefix{Prefix: aws.ToString(prefix.Prefix)})
+	}
+
+	writeXML(w, out)
+}
+
+// toListBucketContent converts an SDK object listing entry to its XML representation.
+func toListBucketContent(obj types.Object) listBucketContent {
+	content := listBucketContent{
+		Key:          aws.ToString(obj.Key),
+		ETag:         aws.ToString(obj.ETag),
+		Size:         aws.ToInt64(obj.Size),
+		StorageClass: string(obj.StorageClass),
+	}
+	if obj.LastModified != nil {
+		content.LastModified = obj.LastModified.Format(http.TimeFormat)
+	}
+	return content
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxClockSkew is the largest allowed difference between the request's
+// X-Amz-Date and the proxy's clock before a SigV4 request is rejected.
+const maxClockSkew = 5 * time.Minute
+
+// Principal describes an S3-compatible API credential and the bucket/prefix
+// it is allowed to operate on.
+type Principal struct {
+	SecretKey     string `mapstructure:"secret_key"`
+	AllowedBucket string `mapstructure:"allowed_bucket"`
+	AllowedPrefix string `mapstructure:"allowed_prefix"`
+	AllowWrite    bool   `mapstructure:"allow_write"`
+}
+
+// authorized reports whether the principal may access key in bucket.
+func (pr Principal) authorized(bucket, key string) bool {
+	if !pr.authorizedBucket(bucket) {
+		return false
+	}
+	return strings.HasPrefix(key, pr.AllowedPrefix)
+}
+
+// authorizedBucket reports whether the principal may operate on bucket at all,
+// independent of any key/prefix (e.g. for bucket-level operations like
+// GetBucketLocation that don't expose keys).
+func (pr Principal) authorizedBucket(bucket string) bool {
+	return pr.AllowedBucket == "" || pr.AllowedBucket == bucket
+}
+
+// authHeader holds the parsed fields of an "Authorization: AWS4-HMAC-SHA256 ..." header.
+type authHeader struct {
+	AccessKeyID   string
+	Date          string
+	Region        string
+	Service       string
+	SignedHeaders []string
+	Signature     string
+}
+
+// scope returns the SigV4 credential scope for this header: <date>/<region>/<service>/aws4_request.
+func (a authHeader) scope() string {
+	return fmt.Sprintf("%s/%s/%s/aws4_request", a.Date, a.Region, a.Service)
+}
+
+// parseAuthHeader parses the value of an AWS4-HMAC-SHA256 Authorization header.
+func parseAuthHeader(header string) (*authHeader, error) {
+	const prefix = "AWS4-HMAC-SHA256 "
+	if !strings.HasPrefix(header, prefix) {
+		return nil, fmt.Errorf("unsupported authorization scheme")
+	}
+
+	fields := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(header, prefix), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("malformed authorization header")
+		}
+		fields[kv[0]] = kv[1]
+	}
+
+	credential := strings.Split(fields["Credential"], "/")
+	if len(credential) != 5 {
+		return nil, fmt.Errorf("malformed credential scope")
+	}
+
+	return &authHeader{
+		AccessKeyID:   credential[0],
+		Date:          credential[1],
+		Region:        credential[2],
+		Service:       credential[3],
+		SignedHeaders: strings.Split(fields["SignedHeaders"], ";"),
+		Signature:     fields["Signature"],
+	}, nil
+}
+
+// hmacSHA256 computes an HMAC-SHA256 of data keyed by key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signingKey derives the SigV4 signing key for the given scope components.
+func signingKey(secret, date, region, service string) []byte {
+	kDate := hmacSHA256([]byte("AWS4"+secret), date)
+	kRegion := hmacSHA256(kDate, region)
+	kService := hmacSHA256(kRegion, service)
+	return hmacSHA256(kService, "aws4_request")
+}
+
+// canonicalURI collapses repeated slashes and returns the escaped request path.
+func canonicalURI(path string) string {
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+	if path == "" {
+		path = "/"
+	}
+	return (&url.URL{Path: path}).EscapedPath()
+}
+
+// canonicalQueryString builds the sorted, %20-encoded canonical query string,
+// excluding X-Amz-Signature (used only for presigned URLs).
+func canonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		if k == "X-Amz-Signature" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, strings.ReplaceAll(url.QueryEscape(k), "+", "%20")+"="+strings.ReplaceAll(url.QueryEscape(v), "+", "%20"))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// canonicalHeaders builds the canonical headers block and signed-headers list for signedHeaders.
+func canonicalHeaders(r *http.Request, signedHeaders []string) string {
+	var b strings.Builder
+	for _, h := range signedHeaders {
+		var value string
+		if strings.EqualFold(h, "host") {
+			value = r.Host
+		} else {
+			value = strings.Join(r.Header.Values(http.CanonicalHeaderKey(h)), ",")
+		}
+		b.WriteString(strings.ToLower(h))
+		b.WriteString(":")
+		b.WriteString(strings.TrimSpace(value))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// canonicalRequest builds the SigV4 canonical request string.
+func canonicalRequest(r *http.Request, signedHeaders []string, payloadHash string) string {
+	return strings.Join([]string{
+		r.Method,
+		canonicalURI(r.URL.Path),
+		canonicalQueryString(r.URL.Query()),
+		canonicalHeaders(r, signedHeaders),
+		strings.ToLower(strings.Join(signedHeaders, ";")),
+		payloadHash,
+	}, "\n")
+}
+
+// stringToSign builds the SigV4 string-to-sign for amzDate, scope and the canonical request.
+func stringToSign(amzDate, scope, canonical string) string {
+	hash := sha256.Sum256([]byte(canonical))
+	return "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+}
+
+// verifySigV4 authenticates r against the configured Principals, accepting
+// either a header-based Authorization or a presigned X-Amz-Signature query
+// request. It returns the authenticated Principal on success.
+func (p *S3Proxy) verifySigV4(r *http.Request) (Principal, error) {
+	if sig := r.URL.Query().Get("X-Amz-Signature"); sig != "" {
+		return p.verifyPresigned(r, sig)
+	}
+
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return Principal{}, fmt.Errorf("missing Authorization header")
+	}
+	auth, err := parseAuthHeader(header)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	if err := checkClockSkew(amzDate); err != nil {
+		return Principal{}, err
+	}
+
+	principal, ok := p.config.Principals[auth.AccessKeyID]
+	if !ok {
+		return Principal{}, fmt.Errorf("unknown access key: %s", auth.AccessKeyID)
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = "UNSIGNED-PAYLOAD"
+	}
+
+	canonical := canonicalRequest(r, auth.SignedHeaders, payloadHash)
+	toSign := stringToSign(amzDate, auth.scope(), canonical)
+	key := signingKey(principal.SecretKey, auth.Date, auth.Region, auth.Service)
+	expected := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	if !hmac.Equal([]byte(expected), []byte(auth.Signature)) {
+		return Principal{}, fmt.Errorf("signature mismatch")
+	}
+
+	// The signature only commits to payloadHash, the client's own claim about
+	// the body's digest; it says nothing about the bytes actually read off the
+	// wire. When the client signed a real digest (as opposed to opting out via
+	// UNSIGNED-PAYLOAD), verify the body against it as it streams to S3 so a
+	// tampered body fails the upload instead of silently landing under a valid
+	// signature.
+	if r.Body != nil && payloadHash != "UNSIGNED-PAYLOAD" {
+		r.Body = newHashVerifyingBody(r.Body, payloadHash)
+	}
+
+	return principal, nil
+}
+
+// hashVerifyingBody wraps a request body and checks, once the underlying
+// reader reaches EOF, that the bytes read hashed to expected. A mismatch is
+// surfaced as a Read error in place of io.EOF, so the in-flight upload this
+// body is being streamed into fails instead of completing on tampered data.
+type hashVerifyingBody struct {
+	r        io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func newHashVerifyingBody(r io.ReadCloser, expectedHash string) *hashVerifyingBody {
+	return &hashVerifyingBody{r: r, hash: sha256.New(), expected: expectedHash}
+}
+
+func (b *hashVerifyingBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if n > 0 {
+		b.hash.Write(p[:n])
+	}
+	if err == io.EOF {
+		if got := hex.EncodeToString(b.hash.Sum(nil)); got != b.expected {
+			return n, fmt.Errorf("body does not match signed X-Amz-Content-Sha256")
+		}
+	}
+	return n, err
+}
+
+func (b *hashVerifyingBody) Close() error {
+	return b.r.Close()
+}
+
+// verifyPresigned authenticates a presigned-URL request carrying X-Amz-Signature in its query string.
+func (p *S3Proxy) verifyPresigned(r *http.Request, signature string) (Principal, error) {
+	q := r.URL.Query()
+	credential := strings.Split(q.Get("X-Amz-Credential"), "/")
+	if len(credential) != 5 {
+		return Principal{}, fmt.Errorf("malformed X-Amz-Credential")
+	}
+
+	amzDate := q.Get("X-Amz-Date")
+	if err := checkPresignedExpiry(amzDate, q.Get("X-Amz-Expires")); err != nil {
+		return Principal{}, err
+	}
+
+	principal, ok := p.config.Principals[credential[0]]
+	if !ok {
+		return Principal{}, fmt.Errorf("unknown access key: %s", credential[0])
+	}
+
+	signedHeaders := strings.Split(q.Get("X-Amz-SignedHeaders"), ";")
+	auth := authHeader{Date: credential[1], Region: credential[2], Service: credential[3]}
+
+	canonical := canonicalRequest(r, signedHeaders, "UNSIGNED-PAYLOAD")
+	toSign := stringToSign(amzDate, auth.scope(), canonical)
+	key := signingKey(principal.SecretKey, auth.Date, auth.Region, auth.Service)
+	expected := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return Principal{}, fmt.Errorf("signature mismatch")
+	}
+
+	return principal, nil
+}
+
+// checkClockSkew rejects requests whose X-Amz-Date is too far from the proxy's clock.
+func checkClockSkew(amzDate string) error {
+	if amzDate == "" {
+		return fmt.Errorf("missing X-Amz-Date")
+	}
+	t, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil {
+		return fmt.Errorf("invalid X-Amz-Date: %v", err)
+	}
+	if skew := time.Since(t); skew > maxClockSkew || skew < -maxClockSkew {
+		return fmt.Errorf("request clock skew too large: %v", skew)
+	}
+	return nil
+}
+
+// checkPresignedExpiry validates a presigned URL against its signed validity
+// window: [X-Amz-Date, X-Amz-Date + X-Amz-Expires], per the SigV4 presigned-URL
+// spec, rather than the flat clock-skew window used for header-based requests.
+func checkPresignedExpiry(amzDate, expiresParam string) error {
+	if amzDate == "" {
+		return fmt.Errorf("missing X-Amz-Date")
+	}
+	signedAt, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil {
+		return fmt.Errorf("invalid X-Amz-Date: %v", err)
+	}
+
+	expiresIn, err := strconv.ParseInt(expiresParam, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid X-Amz-Expires: %v", err)
+	}
+
+	now := time.Now()
+	if now.Before(signedAt) {
+		return fmt.Errorf("presigned URL not yet valid")
+	}
+	if now.After(signedAt.Add(time.Duration(expiresIn) * time.Second)) {
+		return fmt.Errorf("presigned URL expired")
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "AKIATEST"
+	testSecretKey = "test-secret"
+	testRegion    = "us-east-1"
+	testService   = "s3"
+)
+
+// signHeaderRequest builds a GET request to path, signed with secret for
+// accessKey at amzDate, the same way a real SigV4 client would.
+func signHeaderRequest(t *testing.T, accessKey, secret, amzDate, path string) *http.Request {
+	t.Helper()
+
+	r, err := http.NewRequest(http.MethodGet, "http://example.com"+path, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	r.Host = "example.com"
+	r.Header.Set("X-Amz-Date", amzDate)
+
+	auth := authHeader{
+		AccessKeyID:   accessKey,
+		Date:          amzDate[:8],
+		Region:        testRegion,
+		Service:       testService,
+		SignedHeaders: []string{"host", "x-amz-date"},
+	}
+	canonical := canonicalRequest(r, auth.SignedHeaders, "UNSIGNED-PAYLOAD")
+	toSign := stringToSign(amzDate, auth.scope(), canonical)
+	key := signingKey(secret, auth.Date, auth.Region, auth.Service)
+	auth.Signature = hex.EncodeToString(hmacSHA256(key, toSign))
+
+	r.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+auth.scope()+
+		", SignedHeaders=host;x-amz-date, Signature="+auth.Signature)
+	return r
+}
+
+func newTestProxy(principals map[string]Principal) *S3Proxy {
+	return &S3Proxy{config: &ProxyConfig{Principals: principals}}
+}
+
+func TestVerifySigV4(t *testing.T) {
+	now := time.Now().UTC().Format("20060102T150405Z")
+	past := time.Now().UTC().Add(-10 * time.Minute).Format("20060102T150405Z")
+	future := time.Now().UTC().Add(10 * time.Minute).Format("20060102T150405Z")
+
+	principals := map[string]Principal{
+		testAccessKey: {SecretKey: testSecretKey},
+	}
+
+	tests := []struct {
+		name    string
+		req     func() *http.Request
+		wantErr bool
+	}{
+		{
+			name: "valid signature",
+			req:  func() *http.Request { return signHeaderRequest(t, testAccessKey, testSecretKey, now, "/object.txt") },
+		},
+		{
+			name: "tampered signature",
+			req: func() *http.Request {
+				r := signHeaderRequest(t, testAccessKey, testSecretKey, now, "/object.txt")
+				r.URL.Path = "/other-object.txt" // canonical request changes, signature no longer matches
+				return r
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong secret",
+			req: func() *http.Request {
+				return signHeaderRequest(t, testAccessKey, "not-the-real-secret", now, "/object.txt")
+			},
+			wantErr: true,
+		},
+		{
+			name:    "expired clock skew",
+			req:     func() *http.Request { return signHeaderRequest(t, testAccessKey, testSecretKey, past, "/object.txt") },
+			wantErr: true,
+		},
+		{
+			name:    "future clock skew",
+			req:     func() *http.Request { return signHeaderRequest(t, testAccessKey, testSecretKey, future, "/object.txt") },
+			wantErr: true,
+		},
+		{
+			name:    "unknown access key",
+			req:     func() *http.Request { return signHeaderRequest(t, "AKIAUNKNOWN", testSecretKey, now, "/object.txt") },
+			wantErr: true,
+		},
+		{
+			name: "missing authorization header",
+			req: func() *http.Request {
+				r, _ := http.NewRequest(http.MethodGet, "http://example.com/object.txt", nil)
+				return r
+			},
+			wantErr: true,
+		},
+	}
+
+	p := newTestProxy(principals)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.verifySigV4(tt.req())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifySigV4() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// signPresignedRequest builds a GET request carrying presigned SigV4 query
+// parameters signed with secret for accessKey at amzDate, valid for expiresIn.
+func signPresignedRequest(t *testing.T, accessKey, secret, amzDate string, expiresIn time.Duration, path string) *http.Request {
+	t.Helper()
+
+	auth := authHeader{
+		AccessKeyID: accessKey,
+		Date:        amzDate[:8],
+		Region:      testRegion,
+		Service:     testService,
+	}
+
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", accessKey+"/"+auth.scope())
+	q.Set("X-Amz-Date", amzDate)
+	q.Set("X-Amz-Expires", strconv.FormatInt(int64(expiresIn/time.Second), 10))
+	q.Set("X-Amz-SignedHeaders", "host")
+
+	r, err := http.NewRequest(http.MethodGet, "http://example.com"+path+"?"+q.Encode(), nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	r.Host = "example.com"
+
+	canonical := canonicalRequest(r, []string{"host"}, "UNSIGNED-PAYLOAD")
+	toSign := stringToSign(amzDate, auth.scope(), canonical)
+	key := signingKey(secret, auth.Date, auth.Region, auth.Service)
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	values := r.URL.Query()
+	values.Set("X-Amz-Signature", signature)
+	r.URL.RawQuery = values.Encode()
+	return r
+}
+
+func TestVerifyPresigned(t *testing.T) {
+	now := time.Now().UTC().Format("20060102T150405Z")
+	tenMinutesAgo := time.Now().UTC().Add(-10 * time.Minute).Format("20060102T150405Z")
+	inFiveMinutes := time.Now().UTC().Add(5 * time.Minute).Format("20060102T150405Z")
+
+	principals := map[string]Principal{
+		testAccessKey: {SecretKey: testSecretKey},
+	}
+	p := newTestProxy(principals)
+
+	tests := []struct {
+		name    string
+		req     func() *http.Request
+		wantErr bool
+	}{
+		{
+			name: "valid within expiry window",
+			req: func() *http.Request {
+				return signPresignedRequest(t, testAccessKey, testSecretKey, now, 15*time.Minute, "/object.txt")
+			},
+		},
+		{
+			name: "expired",
+			req: func() *http.Request {
+				return signPresignedRequest(t, testAccessKey, testSecretKey, tenMinutesAgo, 5*time.Minute, "/object.txt")
+			},
+			wantErr: true,
+		},
+		{
+			name: "not yet valid",
+			req: func() *http.Request {
+				return signPresignedRequest(t, testAccessKey, testSecretKey, inFiveMinutes, 15*time.Minute, "/object.txt")
+			},
+			wantErr: true,
+		},
+		{
+			name: "tampered signature",
+			req: func() *http.Request {
+				r := signPresignedRequest(t, testAccessKey, testSecretKey, now, 15*time.Minute, "/object.txt")
+				values := r.URL.Query()
+				values.Set("X-Amz-Signature", "0000000000000000000000000000000000000000000000000000000000000000")
+				r.URL.RawQuery = values.Encode()
+				return r
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong secret",
+			req: func() *http.Request {
+				return signPresignedRequest(t, testAccessKey, "not-the-real-secret", now, 15*time.Minute, "/object.txt")
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.req()
+			_, err := p.verifySigV4(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifySigV4() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPrincipalAuthorized(t *testing.T) {
+	tests := []struct {
+		name   string
+		pr     Principal
+		bucket string
+		key    string
+		want   bool
+	}{
+		{
+			name:   "no bucket restriction, no prefix restriction",
+			pr:     Principal{},
+			bucket: "any-bucket",
+			key:    "any/key.txt",
+			want:   true,
+		},
+		{
+			name:   "bucket matches, key under allowed prefix",
+			pr:     Principal{AllowedBucket: "shared-bucket", AllowedPrefix: "tenant-a/"},
+			bucket: "shared-bucket",
+			key:    "tenant-a/file.txt",
+			want:   true,
+		},
+		{
+			name:   "bucket matches, key outside allowed prefix",
+			pr:     Principal{AllowedBucket: "shared-bucket", AllowedPrefix: "tenant-a/"},
+			bucket: "shared-bucket",
+			key:    "tenant-b/secret.txt",
+			want:   false,
+		},
+		{
+			name:   "bucket does not match",
+			pr:     Principal{AllowedBucket: "shared-bucket", AllowedPrefix: "tenant-a/"},
+			bucket: "other-bucket",
+			key:    "tenant-a/file.txt",
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pr.authorized(tt.bucket, tt.key); got != tt.want {
+				t.Errorf("authorized(%q, %q) = %v, want %v", tt.bucket, tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrincipalAuthorizedBucket(t *testing.T) {
+	tests := []struct {
+		name   string
+		pr     Principal
+		bucket string
+		want   bool
+	}{
+		{"no bucket restriction", Principal{}, "any-bucket", true},
+		{"bucket matches", Principal{AllowedBucket: "shared-bucket"}, "shared-bucket", true},
+		{"bucket does not match", Principal{AllowedBucket: "shared-bucket"}, "other-bucket", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pr.authorizedBucket(tt.bucket); got != tt.want {
+				t.Errorf("authorizedBucket(%q) = %v, want %v", tt.bucket, got, tt.want)
+			}
+		})
+	}
+}
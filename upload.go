@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// uploaderPartSize is the part size used when streaming single-object PUTs
+// through manager.Uploader so large bodies never buffer in full.
+const uploaderPartSize = 8 * 1024 * 1024 // 8 MiB, within the 5-16 MiB guidance
+
+// metaHeaderPrefix is the prefix S3 uses for user-supplied object metadata headers.
+const metaHeaderPrefix = "X-Amz-Meta-"
+
+// authorizeWrite gates write requests. In S3CompatMode the request was already
+// verified and ACL-checked via SigV4; otherwise a per-domain bearer token, when
+// configured, must be presented.
+func (p *S3Proxy) authorizeWrite(r *http.Request, cfg StorageConfig, principal Principal) bool {
+	if p.config.S3CompatMode {
+		return principal.AllowWrite
+	}
+	if cfg.WriteAuthToken == "" {
+		return true
+	}
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if len(header) <= len(prefix) || header[:len(prefix)] != prefix {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(header[len(prefix):]), []byte(cfg.WriteAuthToken)) == 1
+}
+
+// serveWrite dispatches PUT/POST/DELETE requests to single-object and multipart upload handling.
+func (p *S3Proxy) serveWrite(w http.ResponseWriter, r *http.Request, client *s3.Client, cfg StorageConfig, objectPath string) {
+	q := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodPut && q.Has("partNumber") && q.Has("uploadId"):
+		p.uploadPart(w, r, client, cfg, objectPath)
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		p.initiateMultipartUpload(w, r, client, cfg, objectPath)
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		p.completeMultipartUpload(w, r, client, cfg, objectPath)
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		p.abortMultipartUpload(w, r, client, cfg, objectPath)
+	case r.Method == http.MethodPut:
+		p.putObject(w, r, client, cfg, objectPath)
+	default:
+		p.Error(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// putObject streams a single-object PUT body straight to S3 via manager.Uploader,
+// so the full body is never buffered in memory or on disk.
+func (p *S3Proxy) putObject(w http.ResponseWriter, r *http.Request, client *s3.Client, cfg StorageConfig, objectPath string) {
+	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = uploaderPartSize
+	})
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(cfg.Bucket),
+		Key:    aws.String(objectPath),
+		Body:   r.Body,
+	}
+	if v := r.Header.Get("Content-Type"); v != "" {
+		input.ContentType = aws.String(v)
+	}
+	if v := r.Header.Get("Cache-Control"); v != "" {
+		input.CacheControl = aws.String(v)
+	}
+	if meta := userMetadata(r.Header); len(meta) > 0 {
+		input.Metadata = meta
+	}
+
+	result, err := uploader.Upload(context.TODO(), input)
+	if err != nil {
+		p.Error(w, http.StatusInternalServerError)
+		return
+	}
+
+	if result.ETag != nil {
+		w.Header().Set("ETag", *result.ETag)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// userMetadata extracts x-amz-meta-* request headers into an S3 object metadata map.
+func userMetadata(header http.Header) map[string]string {
+	meta := make(map[string]string)
+	for key := range header {
+		if !strings.HasPrefix(key, metaHeaderPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, metaHeaderPrefix)
+		meta[strings.ToLower(name)] = header.Get(key)
+	}
+	return meta
+}
+
+// initiateMultipartUpload proxies InitiateMultipartUpload and returns its XML body verbatim.
+func (p *S3Proxy) initiateMultipartUpload(w http.ResponseWriter, r *http.Request, client *s3.Client, cfg StorageConfig, objectPath string) {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(cfg.Bucket),
+		Key:    aws.String(objectPath),
+	}
+	if v := r.Header.Get("Content-Type"); v != "" {
+		input.ContentType = aws.String(v)
+	}
+	if meta := userMetadata(r.Header); len(meta) > 0 {
+		input.Metadata = meta
+	}
+
+	result, err := client.CreateMultipartUpload(context.TODO(), input)
+	if err != nil {
+		p.Error(w, http.StatusInternalServerError)
+		return
+	}
+
+	writeXML(w, struct {
+		XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		UploadID string   `xml:"UploadId"`
+	}{
+		Bucket:   cfg.Bucket,
+		Key:      objectPath,
+		UploadID: aws.ToString(result.UploadId),
+	})
+}
+
+// uploadPart streams a single multipart part body to S3 and returns the resulting ETag.
+func (p *S3Proxy) uploadPart(w http.ResponseWriter, r *http.Request, client *s3.Client, cfg StorageConfig, objectPath string) {
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil {
+		p.Error(w, http.StatusBadRequest)
+		return
+	}
+
+	result, err := client.UploadPart(context.TODO(), &s3.UploadPartInput{
+		Bucket:     aws.String(cfg.Bucket),
+		Key:        aws.String(objectPath),
+		UploadId:   aws.String(r.URL.Query().Get("uploadId")),
+		PartNumber: aws.Int32(int32(partNumber)),
+		Body:       r.Body,
+	})
+	if err != nil {
+		p.Error(w, http.StatusInternalServerError)
+		return
+	}
+
+	if result.ETag != nil {
+		w.Header().Set("ETag", *result.ETag)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// completedPart mirrors the <Part> element of a CompleteMultipartUpload request body.
+type completedPart struct {
+	PartNumber int32  `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// completeMultipartUploadRequest mirrors the CompleteMultipartUpload request body clients send.
+type completeMultipartUploadRequest struct {
+	XMLName xml.Name         `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+// completeMultipartUpload proxies CompleteMultipartUpload and returns its XML body verbatim.
+func (p *S3Proxy) completeMultipartUpload(w http.ResponseWriter, r *http.Request, client *s3.Client, cfg StorageConfig, objectPath string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.Error(w, http.StatusBadRequest)
+		return
+	}
+
+	var req completeMultipartUploadRequest
+	if err := xml.Unmarshal(body, &req); err != nil {
+		p.Error(w, http.StatusBadRequest)
+		return
+	}
+
+	parts := make([]types.CompletedPart, len(req.Parts))
+	for i, part := range req.Parts {
+		parts[i] = types.CompletedPart{
+			PartNumber: aws.Int32(part.PartNumber),
+			ETag:       aws.String(part.ETag),
+		}
+	}
+
+	result, err := client.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(cfg.Bucket),
+		Key:             aws.String(objectPath),
+		UploadId:        aws.String(r.URL.Query().Get("uploadId")),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		p.Error(w, http.StatusInternalServerError)
+		return
+	}
+
+	writeXML(w, struct {
+		XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+		Location string   `xml:"Location"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		ETag     string   `xml:"ETag"`
+	}{
+		Location: aws.ToString(result.Location),
+		Bucket:   cfg.Bucket,
+		Key:      objectPath,
+		ETag:     aws.ToString(result.ETag),
+	})
+}
+
+// abortMultipartUpload proxies AbortMultipartUpload.
+func (p *S3Proxy) abortMultipartUpload(w http.ResponseWriter, r *http.Request, client *s3.Client, cfg StorageConfig, objectPath string) {
+	_, err := client.AbortMultipartUpload(context.TODO(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(cfg.Bucket),
+		Key:      aws.String(objectPath),
+		UploadId: aws.String(r.URL.Query().Get("uploadId")),
+	})
+	if err != nil {
+		p.Error(w, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}